@@ -17,16 +17,45 @@ limitations under the License.
 package inventory
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	gogit "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
+// dirVCSProviderBaseHash and dirVCSProviderHeadHash are sentinel hashes
+// used by DirVCSProvider, which has no real commits to point to, so that
+// its CheckoutManifestsAt can still be driven by the same VCSProvider
+// interface as the git-backed providers.
+var (
+	dirVCSProviderBaseHash = plumbing.NewHash(strings.Repeat("0", 39) + "1")
+	dirVCSProviderHeadHash = plumbing.NewHash(strings.Repeat("0", 39) + "2")
+)
+
+// cosignSignatureAnnotation is the annotation key on a layer of a
+// cosign-style signature artifact that holds the base64-encoded signature
+// over that layer's (uncompressed) payload.
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
 // MBToBytes converts a value from MiB to Bytes.
 func MBToBytes(value int) int {
 	const mbToBytesShift = 20
@@ -54,78 +83,209 @@ func getGitShaFromEnv(envVar string) (plumbing.Hash, error) {
 	return plumbing.NewHash(potenitalSHA), nil
 }
 
-// MKRealImageRemovalCheck returns an instance of ImageRemovalCheck.
-func MKRealImageRemovalCheck(
+// checkoutManifestsAt reads the promoter manifests as they existed at hash
+// in the Git repo at gitRepoPath, without touching the repo's current
+// worktree: it materializes the tree at hash into a temporary directory,
+// parses the manifests there, and cleans up afterwards.
+func checkoutManifestsAt(
 	gitRepoPath string,
-	edges map[PromotionEdge]interface{},
-) (*ImageRemovalCheck, error) {
-	// The "PULL_BASE_SHA" and "PULL_PULL_SHA" environment variables are given
-	// by the PROW job running the promoter container and represent the Git SHAs
-	// for the master branch and the pull request branch respectively.
-	masterSHA, err := getGitShaFromEnv("PULL_BASE_SHA")
+	hash plumbing.Hash,
+) ([]Manifest, error) {
+	r, err := gogit.PlainOpen(gitRepoPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open the Git repo: %v", err)
+	}
+
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find commit %v: %v", hash, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the tree for commit %v: %v",
+			hash, err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "cip-manifests-")
+	if err != nil {
+		return nil, fmt.Errorf("Could not create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		contents, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("Could not read %v at commit %v: %v",
+				f.Name, hash, err)
+		}
+		dstPath := filepath.Join(tmpDir, f.Name)
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+			return fmt.Errorf("Could not create directory for %v: %v",
+				f.Name, err)
+		}
+		return ioutil.WriteFile(dstPath, []byte(contents), 0644)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not materialize commit %v into a"+
+			" temporary directory: %v", hash, err)
+	}
+
+	return ParseThinManifestsFromDir(tmpDir)
+}
+
+// BaseRef returns the master branch's Git SHA, as given by the
+// "PULL_BASE_SHA" environment variable set by the Prow job running the
+// promoter container.
+func (p *ProwVCSProvider) BaseRef() (plumbing.Hash, error) {
+	hash, err := getGitShaFromEnv("PULL_BASE_SHA")
 	if err != nil {
-		return nil, fmt.Errorf("The PULL_BASE_SHA environment variable "+
+		return hash, fmt.Errorf("The PULL_BASE_SHA environment variable "+
 			"is invalid: %v", err)
 	}
-	pullRequestSHA, err := getGitShaFromEnv("PULL_PULL_SHA")
+	return hash, nil
+}
+
+// HeadRef returns the pull request branch's Git SHA, as given by the
+// "PULL_PULL_SHA" environment variable set by the Prow job running the
+// promoter container.
+func (p *ProwVCSProvider) HeadRef() (plumbing.Hash, error) {
+	hash, err := getGitShaFromEnv("PULL_PULL_SHA")
 	if err != nil {
-		return nil, fmt.Errorf("The PULL_PULL_SHA environment variable "+
+		return hash, fmt.Errorf("The PULL_PULL_SHA environment variable "+
 			"is invalid: %v", err)
 	}
-	return &ImageRemovalCheck{
-		gitRepoPath,
-		masterSHA,
-		pullRequestSHA,
-		edges,
-	}, nil
+	return hash, nil
 }
 
-// Run executes ImageRemovalCheck on a set of promotion edges.
-// Returns an error if the pull request removes images from the
-// promoter manifests.
-func (check *ImageRemovalCheck) Run() error {
-	r, err := gogit.PlainOpen(check.GitRepoPath)
+// CheckoutManifestsAt reads the promoter manifests as they existed at
+// hash in the repo at GitRepoPath.
+func (p *ProwVCSProvider) CheckoutManifestsAt(
+	hash plumbing.Hash,
+) ([]Manifest, error) {
+	return checkoutManifestsAt(p.GitRepoPath, hash)
+}
+
+// BaseRef returns the target branch's Git SHA, as given by the
+// "GITHUB_BASE_SHA" environment variable set by GitHub Actions.
+func (p *GitHubActionsVCSProvider) BaseRef() (plumbing.Hash, error) {
+	hash, err := getGitShaFromEnv("GITHUB_BASE_SHA")
 	if err != nil {
-		return fmt.Errorf("Could not open the Git repo: %v", err)
+		return hash, fmt.Errorf("The GITHUB_BASE_SHA environment variable "+
+			"is invalid: %v", err)
 	}
-	w, err := r.Worktree()
+	return hash, nil
+}
+
+// HeadRef returns the Git SHA under test, as given by the "GITHUB_SHA"
+// environment variable set by GitHub Actions.
+func (p *GitHubActionsVCSProvider) HeadRef() (plumbing.Hash, error) {
+	hash, err := getGitShaFromEnv("GITHUB_SHA")
 	if err != nil {
-		return fmt.Errorf("Could not create Git worktree: %v", err)
+		return hash, fmt.Errorf("The GITHUB_SHA environment variable "+
+			"is invalid: %v", err)
 	}
+	return hash, nil
+}
 
-	// The Prow job that this check is running in has already cloned the
-	// git repo for us so we can just checkout the master branch to get the
-	// master branch's version of the promoter manifests.
-	err = w.Checkout(&gogit.CheckoutOptions{
-		Hash:  check.MasterSHA,
-		Force: true,
-	})
+// CheckoutManifestsAt reads the promoter manifests as they existed at
+// hash in the repo at GitRepoPath.
+func (p *GitHubActionsVCSProvider) CheckoutManifestsAt(
+	hash plumbing.Hash,
+) ([]Manifest, error) {
+	return checkoutManifestsAt(p.GitRepoPath, hash)
+}
+
+// BaseRef returns the merge request's target Git SHA, as given by the
+// "CI_MERGE_REQUEST_DIFF_BASE_SHA" environment variable set by GitLab CI.
+func (p *GitLabCIVCSProvider) BaseRef() (plumbing.Hash, error) {
+	hash, err := getGitShaFromEnv("CI_MERGE_REQUEST_DIFF_BASE_SHA")
 	if err != nil {
-		return fmt.Errorf("Could not checkout the master branch of the Git"+
-			" repo: %v", err)
+		return hash, fmt.Errorf("The CI_MERGE_REQUEST_DIFF_BASE_SHA "+
+			"environment variable is invalid: %v", err)
 	}
+	return hash, nil
+}
 
-	mfests, err := ParseThinManifestsFromDir(check.GitRepoPath)
+// HeadRef returns the Git SHA under test, as given by the
+// "CI_COMMIT_SHA" environment variable set by GitLab CI.
+func (p *GitLabCIVCSProvider) HeadRef() (plumbing.Hash, error) {
+	hash, err := getGitShaFromEnv("CI_COMMIT_SHA")
 	if err != nil {
-		return fmt.Errorf("Could not parse manifests from the directory: %v",
-			err)
+		return hash, fmt.Errorf("The CI_COMMIT_SHA environment variable "+
+			"is invalid: %v", err)
+	}
+	return hash, nil
+}
+
+// CheckoutManifestsAt reads the promoter manifests as they existed at
+// hash in the repo at GitRepoPath.
+func (p *GitLabCIVCSProvider) CheckoutManifestsAt(
+	hash plumbing.Hash,
+) ([]Manifest, error) {
+	return checkoutManifestsAt(p.GitRepoPath, hash)
+}
+
+// BaseRef returns the sentinel hash identifying BaseDir. DirVCSProvider
+// has no real commits, so the returned hash is only ever meaningful as an
+// argument to CheckoutManifestsAt.
+func (p *DirVCSProvider) BaseRef() (plumbing.Hash, error) {
+	return dirVCSProviderBaseHash, nil
+}
+
+// HeadRef returns the sentinel hash identifying HeadDir. DirVCSProvider
+// has no real commits, so the returned hash is only ever meaningful as an
+// argument to CheckoutManifestsAt.
+func (p *DirVCSProvider) HeadRef() (plumbing.Hash, error) {
+	return dirVCSProviderHeadHash, nil
+}
+
+// CheckoutManifestsAt reads the promoter manifests from whichever of
+// BaseDir or HeadDir hash identifies.
+func (p *DirVCSProvider) CheckoutManifestsAt(
+	hash plumbing.Hash,
+) ([]Manifest, error) {
+	switch hash {
+	case dirVCSProviderBaseHash:
+		return ParseThinManifestsFromDir(p.BaseDir)
+	case dirVCSProviderHeadHash:
+		return ParseThinManifestsFromDir(p.HeadDir)
+	default:
+		return nil, fmt.Errorf("DirVCSProvider does not recognize ref %v", hash)
+	}
+}
+
+// MKRealImageRemovalCheck returns an instance of ImageRemovalCheck that
+// discovers the base commit and reads the promoter manifests there via
+// vcs; the pull request's side of the comparison is given by edges.
+func MKRealImageRemovalCheck(
+	vcs VCSProvider,
+	edges map[PromotionEdge]interface{},
+) *ImageRemovalCheck {
+	return &ImageRemovalCheck{
+		vcs,
+		edges,
 	}
-	masterEdges, err := ToPromotionEdges(mfests)
+}
+
+// Run executes ImageRemovalCheck on a set of promotion edges.
+// Returns an error if the pull request removes images from the
+// promoter manifests.
+func (check *ImageRemovalCheck) Run() error {
+	baseHash, err := check.VCS.BaseRef()
 	if err != nil {
-		return fmt.Errorf("Could not generate promotion edges from promoter"+
-			" manifests: %v", err)
+		return fmt.Errorf("Could not determine the base ref: %v", err)
 	}
 
-	// Reset the current directory back to the pull request branch so that this
-	// check doesn't leave lasting effects that could affect subsequent checks.
-	err = w.Checkout(&gogit.CheckoutOptions{
-		Hash:  check.PullRequestSHA,
-		Force: true,
-	})
+	baseMfests, err := check.VCS.CheckoutManifestsAt(baseHash)
+	if err != nil {
+		return fmt.Errorf("Could not read the promoter manifests at the"+
+			" base ref: %v", err)
+	}
+	masterEdges, err := ToPromotionEdges(baseMfests)
 	if err != nil {
-		return fmt.Errorf("Could not checkout the pull request branch of the"+
-			" Git repo %v: %v",
-			check.GitRepoPath, err)
+		return fmt.Errorf("Could not generate promotion edges from promoter"+
+			" manifests: %v", err)
 	}
 
 	return check.Compare(masterEdges, check.PullEdges)
@@ -173,10 +333,16 @@ func (check *ImageRemovalCheck) Compare(
 func (err ImageSizeError) Error() string {
 	errStr := ""
 	if len(err.OversizedImages) > 0 {
-		errStr += fmt.Sprintf("The following images were over the max file "+
-			"size of %dMiB:\n%v\n", err.MaxImageSize,
+		errStr += fmt.Sprintf("The following images were over the max total "+
+			"file size of %dMiB:\n%v\n", err.MaxImageSizeTotal,
 			err.joinImageSizesToString(err.OversizedImages))
 	}
+	if len(err.OversizedPlatformImages) > 0 {
+		errStr += fmt.Sprintf("The following images had a platform over the "+
+			"max per-platform file size of %dMiB:\n%v\n",
+			err.MaxImageSizePerPlatform,
+			err.joinPlatformImageSizesToString(err.OversizedPlatformImages))
+	}
 	if len(err.InvalidImages) > 0 {
 		errStr += fmt.Sprintf("The following images had an invalid file size "+
 			"of 0 bytes or less:\n%v\n",
@@ -204,44 +370,577 @@ func (err ImageSizeError) joinImageSizesToString(
 	return imageSizesStr
 }
 
+func (err ImageSizeError) joinPlatformImageSizesToString(
+	platformImageSizes map[string]map[Platform]int,
+) string {
+	imageSizesStr := ""
+	imageNames := make([]string, 0)
+	for k := range platformImageSizes {
+		imageNames = append(imageNames, k)
+	}
+	sort.Strings(imageNames)
+
+	lines := make([]string, 0)
+	for _, imageName := range imageNames {
+		platforms := make([]Platform, 0)
+		for platform := range platformImageSizes[imageName] {
+			platforms = append(platforms, platform)
+		}
+		sort.Slice(platforms, func(i, j int) bool {
+			return fmt.Sprint(platforms[i]) < fmt.Sprint(platforms[j])
+		})
+		for _, platform := range platforms {
+			lines = append(lines, fmt.Sprintf("%s (%s/%s: %d MiB)",
+				imageName, platform.OS, platform.Architecture,
+				BytesToMB(platformImageSizes[imageName][platform])))
+		}
+	}
+	imageSizesStr = strings.Join(lines, "\n")
+	return imageSizesStr
+}
+
 // MKRealImageSizeCheck returns an instance of ImageSizeCheck which
-// checks that all images to be promoted are under a max size.
+// checks that all images to be promoted are under a max size. A
+// maxImageSizeTotal or maxImageSizePerPlatform of 0 leaves that dimension
+// unbounded.
 func MKRealImageSizeCheck(
-	maxImageSize int,
+	maxImageSizeTotal int,
+	maxImageSizePerPlatform int,
 	edges map[PromotionEdge]interface{},
 	digestImageSize DigestImageSize,
 ) *ImageSizeCheck {
 	return &ImageSizeCheck{
-		maxImageSize,
+		maxImageSizeTotal,
+		maxImageSizePerPlatform,
 		digestImageSize,
 		edges,
 	}
 }
 
-// Run is a function of ImageSizeCheck and checks that all
-// images to be promoted are under the max file size.
+// Run is a function of ImageSizeCheck and checks that all images to be
+// promoted are under the max file size, both in total and (for manifest
+// lists) per platform.
 func (check *ImageSizeCheck) Run() error {
-	maxImageSizeByte := MBToBytes(check.MaxImageSize)
 	oversizedImages := make(map[string]int)
+	oversizedPlatformImages := make(map[string]map[Platform]int)
 	invalidImages := make(map[string]int)
+
 	for edge := range check.PullEdges {
 		imageSize := check.DigestImageSize[edge.Digest]
 		imageName := string(edge.DstImageTag.ImageName)
-		if imageSize > maxImageSizeByte {
-			oversizedImages[imageName] = imageSize
+		total := imageSize.Total()
+
+		if total <= 0 {
+			invalidImages[imageName] = total
+			continue
+		}
+
+		if check.MaxImageSizeTotal > 0 &&
+			total > MBToBytes(check.MaxImageSizeTotal) {
+			oversizedImages[imageName] = total
 		}
-		if imageSize <= 0 {
-			invalidImages[imageName] = imageSize
+
+		if check.MaxImageSizePerPlatform > 0 {
+			maxPerPlatformByte := MBToBytes(check.MaxImageSizePerPlatform)
+			for platform, size := range imageSize.PerPlatform {
+				if size > maxPerPlatformByte {
+					if oversizedPlatformImages[imageName] == nil {
+						oversizedPlatformImages[imageName] = make(map[Platform]int)
+					}
+					oversizedPlatformImages[imageName][platform] = size
+				}
+			}
 		}
 	}
 
-	if len(oversizedImages) > 0 || len(invalidImages) > 0 {
+	if len(oversizedImages) > 0 || len(oversizedPlatformImages) > 0 ||
+		len(invalidImages) > 0 {
 		return ImageSizeError{
-			check.MaxImageSize,
+			check.MaxImageSizeTotal,
+			check.MaxImageSizePerPlatform,
 			oversizedImages,
+			oversizedPlatformImages,
 			invalidImages,
 		}
 	}
 
 	return nil
 }
+
+// Error is a function of DanglingImageError and implements the error
+// interface.
+func (err DanglingImageError) Error() string {
+	images := make([]string, 0, len(err.DanglingImages))
+	for _, img := range err.DanglingImages {
+		line := fmt.Sprintf("%v/%v@%v", img.Registry, img.Image, img.Digest)
+		if img.PreExisting {
+			line += " (previously tagged, now dangling)"
+		}
+		images = append(images, line)
+	}
+	sort.Strings(images)
+	return fmt.Sprintf("The following images are dangling -- written to "+
+		"their destination but referenced by no tag:\n%v",
+		strings.Join(images, "\n"))
+}
+
+// MKRealDanglingTagCheck returns an instance of DanglingTagCheck that
+// discovers the base commit and reads the promoter manifests there via
+// vcs, the same way MKRealImageRemovalCheck does.
+func MKRealDanglingTagCheck(
+	vcs VCSProvider,
+	pullEdges map[PromotionEdge]interface{},
+) *DanglingTagCheck {
+	return &DanglingTagCheck{
+		vcs,
+		pullEdges,
+	}
+}
+
+// Run executes DanglingTagCheck on a set of promotion edges.
+func (check *DanglingTagCheck) Run() error {
+	baseHash, err := check.VCS.BaseRef()
+	if err != nil {
+		return fmt.Errorf("Could not determine the base ref: %v", err)
+	}
+
+	baseMfests, err := check.VCS.CheckoutManifestsAt(baseHash)
+	if err != nil {
+		return fmt.Errorf("Could not read the promoter manifests at the"+
+			" base ref: %v", err)
+	}
+	masterEdges, err := ToPromotionEdges(baseMfests)
+	if err != nil {
+		return fmt.Errorf("Could not generate promotion edges from promoter"+
+			" manifests: %v", err)
+	}
+
+	return check.Compare(masterEdges, check.PullEdges)
+}
+
+// digestTagKey identifies a destination digest within a single
+// (registry, image) pair so that tags are only ever compared against the
+// digests they could plausibly apply to.
+type digestTagKey struct {
+	Registry RegistryName
+	Image    ImageName
+	Digest   Digest
+}
+
+// digestTags builds a reverse index from destination digests to the tags
+// that reference them, keyed per (registry, image, digest) so that tags
+// are only ever compared against the digests they could plausibly apply
+// to.
+func digestTags(edges map[PromotionEdge]interface{}) map[digestTagKey]map[Tag]interface{} {
+	digestTags := make(map[digestTagKey]map[Tag]interface{})
+	for edge := range edges {
+		key := digestTagKey{
+			edge.DstRegistry.Name,
+			edge.DstImageTag.ImageName,
+			edge.Digest,
+		}
+		if digestTags[key] == nil {
+			digestTags[key] = make(map[Tag]interface{})
+		}
+		if edge.DstImageTag.Tag != "" {
+			digestTags[key][edge.DstImageTag.Tag] = nil
+		}
+	}
+	return digestTags
+}
+
+// Compare is a function of DanglingTagCheck that builds a reverse index
+// from destination digests to the tags that reference them, using only
+// the pull request's promotion edges -- this is the post-promotion state
+// that actually matters, and is what decides whether a digest ends up
+// dangling. The master branch's edges are indexed the same way, only to
+// record whether a dangling digest is pre-existing (it had a tag on
+// master and lost it) or newly introduced (it never had one on master
+// either), similar to how ImageRemovalCheck.Compare walks both sets.
+func (check *DanglingTagCheck) Compare(
+	edgesMaster map[PromotionEdge]interface{},
+	edgesPullRequest map[PromotionEdge]interface{},
+) error {
+	masterDigestTags := digestTags(edgesMaster)
+	prDigestTags := digestTags(edgesPullRequest)
+
+	danglingImages := make([]DanglingImage, 0)
+	for key, tags := range prDigestTags {
+		if len(tags) > 0 {
+			continue
+		}
+		preExisting := len(masterDigestTags[key]) > 0
+		danglingImages = append(danglingImages, DanglingImage{
+			key.Registry,
+			key.Image,
+			key.Digest,
+			preExisting,
+		})
+	}
+
+	if len(danglingImages) > 0 {
+		return DanglingImageError{danglingImages}
+	}
+
+	return nil
+}
+
+// Error is a function of SignatureVerificationError and implements the
+// error interface.
+func (err SignatureVerificationError) Error() string {
+	errStr := ""
+	if len(err.UnsignedImages) > 0 {
+		sort.Strings(err.UnsignedImages)
+		errStr += fmt.Sprintf("The following images are not signed by %q:\n%v\n",
+			err.SignerAccount, strings.Join(err.UnsignedImages, "\n"))
+	}
+	if len(err.UnauthorizedImages) > 0 {
+		sort.Strings(err.UnauthorizedImages)
+		errStr += fmt.Sprintf("The following images are signed by a party "+
+			"other than %q:\n%v\n",
+			err.SignerAccount, strings.Join(err.UnauthorizedImages, "\n"))
+	}
+	return errStr
+}
+
+// sigTagForDigest returns the tag under which a cosign-style signature
+// artifact for digest is expected to live in the same repo as the image,
+// e.g. "sha256-<hex>.sig".
+func sigTagForDigest(digest Digest) string {
+	hexDigest := strings.TrimPrefix(string(digest), "sha256:")
+	return fmt.Sprintf("sha256-%s.sig", hexDigest)
+}
+
+// realSignatureVerifier is the production SignatureVerifier, backed by a
+// real registry fetch and cryptographic verification against a configured
+// signer's public key.
+type realSignatureVerifier struct {
+	signerAccount string
+}
+
+// VerifySignature is a function of realSignatureVerifier and implements
+// SignatureVerifier.
+func (v *realSignatureVerifier) VerifySignature(
+	registry RegistryContext, image ImageName, digest Digest,
+) error {
+	return verifySourceSignature(registry, image, digest, v.signerAccount)
+}
+
+// MKRealSignatureVerificationCheck returns an instance of
+// SignatureVerificationCheck. signerAccount must be a PEM-encoded ECDSA
+// public key; only signatures that cryptographically verify against it
+// are accepted.
+func MKRealSignatureVerificationCheck(
+	signerAccount string,
+	edges map[PromotionEdge]interface{},
+) *SignatureVerificationCheck {
+	return &SignatureVerificationCheck{
+		signerAccount,
+		edges,
+		&realSignatureVerifier{signerAccount},
+	}
+}
+
+// Run is a function of SignatureVerificationCheck and checks that every
+// source image in the pull request's promotion edges carries a signature
+// that cryptographically verifies against the configured signer's public
+// key.
+func (check *SignatureVerificationCheck) Run() error {
+	unsignedImages := make([]string, 0)
+	unauthorizedImages := make([]string, 0)
+
+	for edge := range check.PullEdges {
+		imageName := string(edge.SrcImageTag.ImageName)
+
+		err := check.Verifier.VerifySignature(
+			edge.SrcRegistry, edge.SrcImageTag.ImageName, edge.Digest)
+		if err == nil {
+			continue
+		}
+
+		var notFound *errSignatureNotFound
+		if errors.As(err, &notFound) {
+			unsignedImages = append(unsignedImages, imageName)
+			continue
+		}
+
+		var unauthorized *errSignatureUnauthorized
+		if errors.As(err, &unauthorized) {
+			unauthorizedImages = append(unauthorizedImages, imageName)
+			continue
+		}
+
+		// Anything else (registry outage, auth failure, malformed ref) is
+		// a problem with the check itself, not a verdict on the image, so
+		// it must not be silently folded into "unsigned".
+		return fmt.Errorf("Could not verify the signature for %v: %v",
+			imageName, err)
+	}
+
+	if len(unsignedImages) > 0 || len(unauthorizedImages) > 0 {
+		return SignatureVerificationError{
+			check.SignerAccount,
+			unsignedImages,
+			unauthorizedImages,
+		}
+	}
+
+	return nil
+}
+
+// errSignatureNotFound indicates that a source image has no signature
+// artifact, or one with no layers, as opposed to having one whose
+// signatures fail to verify.
+type errSignatureNotFound struct {
+	ref name.Reference
+	err error
+}
+
+func (e *errSignatureNotFound) Error() string {
+	return fmt.Sprintf("no signature artifact found at %v: %v", e.ref, e.err)
+}
+
+func (e *errSignatureNotFound) Unwrap() error { return e.err }
+
+// errSignatureUnauthorized indicates that a source image has a signature
+// artifact, but none of its signatures verify against the configured
+// signer's public key.
+type errSignatureUnauthorized struct {
+	ref name.Reference
+	err error
+}
+
+func (e *errSignatureUnauthorized) Error() string {
+	return fmt.Sprintf("no signature on %v verifies against the configured"+
+		" signer: %v", e.ref, e.err)
+}
+
+func (e *errSignatureUnauthorized) Unwrap() error { return e.err }
+
+// loadECDSAPublicKey parses a PEM-encoded ECDSA public key.
+func loadECDSAPublicKey(pemKey string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, fmt.Errorf("not a valid PEM-encoded public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key: %v", err)
+	}
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("configured signer key is not an ECDSA public key")
+	}
+	return ecdsaPub, nil
+}
+
+// fetchLayerPayload fetches and decompresses the blob for a single layer
+// of the repo that ref points at.
+func fetchLayerPayload(ref name.Reference, layerDigest v1.Hash) ([]byte, error) {
+	layerRef, err := name.NewDigest(
+		fmt.Sprintf("%s@%s", ref.Context(), layerDigest))
+	if err != nil {
+		return nil, fmt.Errorf("Could not construct layer reference: %v", err)
+	}
+
+	layer, err := remote.Layer(layerRef)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch layer %v: %v", layerRef, err)
+	}
+
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read layer %v: %v", layerRef, err)
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// simpleSigningPayload is the subset of a cosign "simple signing" payload
+// this check relies on: the subject digest being attested to, nested under
+// "critical.image.docker-manifest-digest" per the simple signing spec.
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifySourceSignature fetches the cosign-style signature artifact for an
+// image digest from its source registry and cryptographically verifies
+// that at least one of its signatures validates against the configured
+// signer's ECDSA public key, and that the signed payload actually attests
+// to this digest. It never trusts a self-asserted identity annotation --
+// only a signature that verifies under the configured key, over a payload
+// naming this exact digest, counts as authorized.
+func verifySourceSignature(
+	registry RegistryContext,
+	image ImageName,
+	digest Digest,
+	signerPublicKeyPEM string,
+) error {
+	verifier, err := loadECDSAPublicKey(signerPublicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("Could not load the configured signer's public key: %v", err)
+	}
+
+	sigTag := sigTagForDigest(digest)
+	ref, err := name.NewTag(fmt.Sprintf("%v/%v:%v", registry.Name, image, sigTag))
+	if err != nil {
+		return fmt.Errorf("Could not construct signature tag reference: %v", err)
+	}
+
+	desc, err := remote.Get(ref)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return &errSignatureNotFound{ref, err}
+		}
+		return fmt.Errorf("Could not fetch signature artifact %v: %v", ref, err)
+	}
+
+	manifest, err := desc.Manifest()
+	if err != nil {
+		return fmt.Errorf("Could not read signature manifest %v: %v", ref, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return &errSignatureNotFound{ref, fmt.Errorf("signature artifact has no layers")}
+	}
+
+	var lastErr error
+	for _, layer := range manifest.Layers {
+		sigB64, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(sigB64)
+		if err != nil {
+			lastErr = fmt.Errorf("could not decode signature: %v", err)
+			continue
+		}
+		payload, err := fetchLayerPayload(ref, layer.Digest)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		hashed := sha256.Sum256(payload)
+		if !ecdsa.VerifyASN1(verifier, hashed[:], sig) {
+			lastErr = fmt.Errorf("signature did not verify against the" +
+				" configured signer's public key")
+			continue
+		}
+		var simpleSigning simpleSigningPayload
+		if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+			lastErr = fmt.Errorf("could not parse signed payload: %v", err)
+			continue
+		}
+		if simpleSigning.Critical.Image.DockerManifestDigest != string(digest) {
+			lastErr = fmt.Errorf("signed payload attests to digest %q, not"+
+				" the promoted digest %q",
+				simpleSigning.Critical.Image.DockerManifestDigest, digest)
+			continue
+		}
+		return nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("signature artifact has no recognized signature layers")
+	}
+	return &errSignatureUnauthorized{ref, lastErr}
+}
+
+// severityRank orders vulnerability severities from least to most severe.
+var severityRank = map[string]int{
+	"LOW":      0,
+	"MEDIUM":   1,
+	"HIGH":     2,
+	"CRITICAL": 3,
+}
+
+// Error is a function of VulnerabilityError and implements the error
+// interface.
+func (err VulnerabilityError) Error() string {
+	errStr := fmt.Sprintf("The following images have vulnerabilities at or"+
+		" above the %q severity threshold:\n", err.SeverityThreshold)
+
+	severities := make([]string, 0, len(err.ImagesBySeverity))
+	for severity := range err.ImagesBySeverity {
+		severities = append(severities, severity)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		return severityRank[severities[i]] > severityRank[severities[j]]
+	})
+
+	for _, severity := range severities {
+		images := err.ImagesBySeverity[severity]
+		sort.Strings(images)
+		errStr += fmt.Sprintf("%s:\n%v\n", severity, strings.Join(images, "\n"))
+	}
+
+	return errStr
+}
+
+// MKRealVulnerabilityCheck returns an instance of VulnerabilityCheck which
+// checks that no image to be promoted has a vulnerability at or above
+// severityThreshold.
+func MKRealVulnerabilityCheck(
+	severityThreshold string,
+	edges map[PromotionEdge]interface{},
+	scanner VulnScanner,
+) *VulnerabilityCheck {
+	return &VulnerabilityCheck{
+		severityThreshold,
+		edges,
+		scanner,
+	}
+}
+
+// Run is a function of VulnerabilityCheck and checks that no image in the
+// pull request's promotion edges has a vulnerability finding at or above
+// the configured severity threshold.
+func (check *VulnerabilityCheck) Run() error {
+	thresholdRank, ok := severityRank[check.SeverityThreshold]
+	if !ok {
+		return fmt.Errorf("Invalid severity threshold %q", check.SeverityThreshold)
+	}
+
+	imagesBySeverity := make(map[string][]string)
+	for edge := range check.PullEdges {
+		findings, err := check.Scanner.Findings(
+			edge.SrcRegistry, edge.SrcImageTag.ImageName, edge.Digest)
+		if err != nil {
+			return fmt.Errorf("Could not get vulnerability findings for %v: %v",
+				edge.SrcImageTag.ImageName, err)
+		}
+
+		highestSeverity := ""
+		highestRank := -1
+		for _, finding := range findings {
+			rank, ok := severityRank[finding.Severity]
+			if !ok {
+				continue
+			}
+			if rank > highestRank {
+				highestRank = rank
+				highestSeverity = finding.Severity
+			}
+		}
+
+		if highestRank >= thresholdRank {
+			imageName := string(edge.DstImageTag.ImageName)
+			imagesBySeverity[highestSeverity] = append(
+				imagesBySeverity[highestSeverity], imageName)
+		}
+	}
+
+	if len(imagesBySeverity) > 0 {
+		return VulnerabilityError{
+			check.SeverityThreshold,
+			imagesBySeverity,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,463 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// fakeVulnScanner is a VulnScanner that returns a fixed set of findings
+// per digest, for exercising VulnerabilityCheck without a real scanning
+// backend.
+type fakeVulnScanner struct {
+	findings map[Digest][]VulnFinding
+	err      error
+}
+
+func (f *fakeVulnScanner) Findings(
+	registry RegistryContext,
+	image ImageName,
+	digest Digest,
+) ([]VulnFinding, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.findings[digest], nil
+}
+
+// fakeSignatureVerifier is a SignatureVerifier that returns a fixed error
+// per digest, for exercising SignatureVerificationCheck without a real
+// registry or signer.
+type fakeSignatureVerifier struct {
+	errs map[Digest]error
+}
+
+func (f *fakeSignatureVerifier) VerifySignature(
+	registry RegistryContext, image ImageName, digest Digest,
+) error {
+	return f.errs[digest]
+}
+
+func testEdges() map[PromotionEdge]interface{} {
+	edge := PromotionEdge{
+		SrcRegistry: RegistryContext{Name: "gcr.io/src"},
+		SrcImageTag: ImageTag{ImageName: "foo", Tag: "v1"},
+		DstRegistry: RegistryContext{Name: "gcr.io/dst"},
+		DstImageTag: ImageTag{ImageName: "foo", Tag: "v1"},
+		Digest:      "sha256:aaa",
+	}
+	return map[PromotionEdge]interface{}{edge: nil}
+}
+
+// testImageEdge builds a promotion edge for a given image name and
+// digest, for tests that need more than one distinct image.
+func testImageEdge(image ImageName, digest Digest) PromotionEdge {
+	return PromotionEdge{
+		SrcRegistry: RegistryContext{Name: "gcr.io/src"},
+		SrcImageTag: ImageTag{ImageName: image, Tag: "v1"},
+		DstRegistry: RegistryContext{Name: "gcr.io/dst"},
+		DstImageTag: ImageTag{ImageName: image, Tag: "v1"},
+		Digest:      digest,
+	}
+}
+
+func TestProwVCSProviderRefs(t *testing.T) {
+	validSHA := strings.Repeat("a", 40)
+
+	t.Run("BaseRef reads PULL_BASE_SHA", func(t *testing.T) {
+		t.Setenv("PULL_BASE_SHA", validSHA)
+		hash, err := (&ProwVCSProvider{}).BaseRef()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hash != plumbing.NewHash(validSHA) {
+			t.Errorf("expected hash %v, got %v", plumbing.NewHash(validSHA), hash)
+		}
+	})
+
+	t.Run("HeadRef reads PULL_PULL_SHA", func(t *testing.T) {
+		t.Setenv("PULL_PULL_SHA", validSHA)
+		hash, err := (&ProwVCSProvider{}).HeadRef()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hash != plumbing.NewHash(validSHA) {
+			t.Errorf("expected hash %v, got %v", plumbing.NewHash(validSHA), hash)
+		}
+	})
+
+	t.Run("BaseRef rejects a SHA of the wrong length", func(t *testing.T) {
+		t.Setenv("PULL_BASE_SHA", "deadbeef")
+		if _, err := (&ProwVCSProvider{}).BaseRef(); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("BaseRef rejects a non-hex SHA", func(t *testing.T) {
+		t.Setenv("PULL_BASE_SHA", strings.Repeat("z", 40))
+		if _, err := (&ProwVCSProvider{}).BaseRef(); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
+
+func TestGitHubActionsVCSProviderRefs(t *testing.T) {
+	validSHA := strings.Repeat("b", 40)
+
+	t.Run("BaseRef reads GITHUB_BASE_SHA", func(t *testing.T) {
+		t.Setenv("GITHUB_BASE_SHA", validSHA)
+		hash, err := (&GitHubActionsVCSProvider{}).BaseRef()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hash != plumbing.NewHash(validSHA) {
+			t.Errorf("expected hash %v, got %v", plumbing.NewHash(validSHA), hash)
+		}
+	})
+
+	t.Run("HeadRef reads GITHUB_SHA", func(t *testing.T) {
+		t.Setenv("GITHUB_SHA", validSHA)
+		hash, err := (&GitHubActionsVCSProvider{}).HeadRef()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hash != plumbing.NewHash(validSHA) {
+			t.Errorf("expected hash %v, got %v", plumbing.NewHash(validSHA), hash)
+		}
+	})
+}
+
+func TestGitLabCIVCSProviderRefs(t *testing.T) {
+	validSHA := strings.Repeat("c", 40)
+
+	t.Run("BaseRef reads CI_MERGE_REQUEST_DIFF_BASE_SHA", func(t *testing.T) {
+		t.Setenv("CI_MERGE_REQUEST_DIFF_BASE_SHA", validSHA)
+		hash, err := (&GitLabCIVCSProvider{}).BaseRef()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hash != plumbing.NewHash(validSHA) {
+			t.Errorf("expected hash %v, got %v", plumbing.NewHash(validSHA), hash)
+		}
+	})
+
+	t.Run("HeadRef reads CI_COMMIT_SHA", func(t *testing.T) {
+		t.Setenv("CI_COMMIT_SHA", validSHA)
+		hash, err := (&GitLabCIVCSProvider{}).HeadRef()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hash != plumbing.NewHash(validSHA) {
+			t.Errorf("expected hash %v, got %v", plumbing.NewHash(validSHA), hash)
+		}
+	})
+}
+
+func TestDirVCSProviderRefs(t *testing.T) {
+	p := &DirVCSProvider{BaseDir: "/tmp/base", HeadDir: "/tmp/head"}
+
+	baseHash, err := p.BaseRef()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	headHash, err := p.HeadRef()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if baseHash == headHash {
+		t.Errorf("expected BaseRef and HeadRef to return distinct sentinel"+
+			" hashes, got %v for both", baseHash)
+	}
+
+	t.Run("CheckoutManifestsAt rejects a hash that is neither sentinel", func(t *testing.T) {
+		if _, err := p.CheckoutManifestsAt(plumbing.NewHash(strings.Repeat("9", 40))); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
+
+func TestImageSizeCheckRun(t *testing.T) {
+	t.Run("flags a manifest list whose total is fine but one platform is oversized", func(t *testing.T) {
+		edges := map[PromotionEdge]interface{}{
+			testImageEdge("multiarch", "sha256:multi"): nil,
+		}
+		digestImageSize := DigestImageSize{
+			"sha256:multi": ImageSize{
+				PerPlatform: map[Platform]int{
+					{OS: "linux", Architecture: "amd64"}: MBToBytes(10),
+					{OS: "linux", Architecture: "arm64"}: MBToBytes(90),
+				},
+			},
+		}
+		check := MKRealImageSizeCheck(1000, 50, edges, digestImageSize)
+		err := check.Run()
+		sizeErr, ok := err.(ImageSizeError)
+		if !ok {
+			t.Fatalf("expected an ImageSizeError, got %T (%v)", err, err)
+		}
+		if len(sizeErr.OversizedImages) != 0 {
+			t.Errorf("expected no images flagged by total size, got %v",
+				sizeErr.OversizedImages)
+		}
+		platforms := sizeErr.OversizedPlatformImages["multiarch"]
+		if len(platforms) != 1 || platforms[Platform{OS: "linux", Architecture: "arm64"}] != MBToBytes(90) {
+			t.Errorf("expected multiarch/linux/arm64 to be flagged oversized, got %v",
+				sizeErr.OversizedPlatformImages)
+		}
+	})
+
+	t.Run("flags a single-platform image whose total exceeds the max", func(t *testing.T) {
+		edges := map[PromotionEdge]interface{}{
+			testImageEdge("big", "sha256:big"): nil,
+		}
+		digestImageSize := DigestImageSize{
+			"sha256:big": ImageSize{
+				PerPlatform: map[Platform]int{
+					{OS: "linux", Architecture: "amd64"}: MBToBytes(200),
+				},
+			},
+		}
+		check := MKRealImageSizeCheck(100, 0, edges, digestImageSize)
+		err := check.Run()
+		sizeErr, ok := err.(ImageSizeError)
+		if !ok {
+			t.Fatalf("expected an ImageSizeError, got %T (%v)", err, err)
+		}
+		if sizeErr.OversizedImages["big"] != MBToBytes(200) {
+			t.Errorf("expected big to be flagged oversized, got %v",
+				sizeErr.OversizedImages)
+		}
+	})
+
+	t.Run("flags a digest missing from DigestImageSize as invalid", func(t *testing.T) {
+		edges := map[PromotionEdge]interface{}{
+			testImageEdge("missing", "sha256:missing"): nil,
+		}
+		check := MKRealImageSizeCheck(100, 50, edges, DigestImageSize{})
+		err := check.Run()
+		sizeErr, ok := err.(ImageSizeError)
+		if !ok {
+			t.Fatalf("expected an ImageSizeError, got %T (%v)", err, err)
+		}
+		if size, found := sizeErr.InvalidImages["missing"]; !found || size != 0 {
+			t.Errorf("expected missing to be flagged invalid with size 0, got %v",
+				sizeErr.InvalidImages)
+		}
+	})
+
+	t.Run("a 0 threshold leaves that dimension unbounded", func(t *testing.T) {
+		edges := map[PromotionEdge]interface{}{
+			testImageEdge("huge", "sha256:huge"): nil,
+		}
+		digestImageSize := DigestImageSize{
+			"sha256:huge": ImageSize{
+				PerPlatform: map[Platform]int{
+					{OS: "linux", Architecture: "amd64"}: MBToBytes(10000),
+				},
+			},
+		}
+		check := MKRealImageSizeCheck(0, 0, edges, digestImageSize)
+		if err := check.Run(); err != nil {
+			t.Errorf("expected no error with both thresholds at 0, got %v", err)
+		}
+	})
+}
+
+func TestVulnerabilityCheckRun(t *testing.T) {
+	edges := testEdges()
+
+	t.Run("passes when no findings are at or above the threshold", func(t *testing.T) {
+		scanner := &fakeVulnScanner{
+			findings: map[Digest][]VulnFinding{
+				"sha256:aaa": {{CVE: "CVE-1", Severity: "LOW"}},
+			},
+		}
+		check := MKRealVulnerabilityCheck("HIGH", edges, scanner)
+		if err := check.Run(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("fails when a finding is at or above the threshold", func(t *testing.T) {
+		scanner := &fakeVulnScanner{
+			findings: map[Digest][]VulnFinding{
+				"sha256:aaa": {{CVE: "CVE-2", Severity: "CRITICAL"}},
+			},
+		}
+		check := MKRealVulnerabilityCheck("HIGH", edges, scanner)
+		err := check.Run()
+		if err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		vulnErr, ok := err.(VulnerabilityError)
+		if !ok {
+			t.Fatalf("expected a VulnerabilityError, got %T", err)
+		}
+		images := vulnErr.ImagesBySeverity["CRITICAL"]
+		if len(images) != 1 || images[0] != "foo" {
+			t.Errorf("expected foo to be flagged as CRITICAL, got %v",
+				vulnErr.ImagesBySeverity)
+		}
+	})
+
+	t.Run("propagates scanner errors instead of treating them as findings", func(t *testing.T) {
+		scanner := &fakeVulnScanner{err: fmt.Errorf("scanner unavailable")}
+		check := MKRealVulnerabilityCheck("HIGH", edges, scanner)
+		if err := check.Run(); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
+
+func TestSignatureVerificationCheckRun(t *testing.T) {
+	edges := testEdges()
+
+	t.Run("passes when the image's signature verifies", func(t *testing.T) {
+		verifier := &fakeSignatureVerifier{
+			errs: map[Digest]error{},
+		}
+		check := &SignatureVerificationCheck{
+			SignerAccount: "signer-key",
+			PullEdges:     edges,
+			Verifier:      verifier,
+		}
+		if err := check.Run(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("flags an image with no signature artifact as unsigned", func(t *testing.T) {
+		verifier := &fakeSignatureVerifier{
+			errs: map[Digest]error{
+				"sha256:aaa": &errSignatureNotFound{err: fmt.Errorf("404")},
+			},
+		}
+		check := &SignatureVerificationCheck{
+			SignerAccount: "signer-key",
+			PullEdges:     edges,
+			Verifier:      verifier,
+		}
+		err := check.Run()
+		sigErr, ok := err.(SignatureVerificationError)
+		if !ok {
+			t.Fatalf("expected a SignatureVerificationError, got %T (%v)", err, err)
+		}
+		if len(sigErr.UnsignedImages) != 1 || sigErr.UnsignedImages[0] != "foo" {
+			t.Errorf("expected foo to be flagged as unsigned, got %v",
+				sigErr.UnsignedImages)
+		}
+	})
+
+	t.Run("flags an image whose signature doesn't verify as unauthorized", func(t *testing.T) {
+		verifier := &fakeSignatureVerifier{
+			errs: map[Digest]error{
+				"sha256:aaa": &errSignatureUnauthorized{err: fmt.Errorf("bad signature")},
+			},
+		}
+		check := &SignatureVerificationCheck{
+			SignerAccount: "signer-key",
+			PullEdges:     edges,
+			Verifier:      verifier,
+		}
+		err := check.Run()
+		sigErr, ok := err.(SignatureVerificationError)
+		if !ok {
+			t.Fatalf("expected a SignatureVerificationError, got %T (%v)", err, err)
+		}
+		if len(sigErr.UnauthorizedImages) != 1 || sigErr.UnauthorizedImages[0] != "foo" {
+			t.Errorf("expected foo to be flagged as unauthorized, got %v",
+				sigErr.UnauthorizedImages)
+		}
+	})
+
+	t.Run("propagates other errors instead of treating them as a verdict", func(t *testing.T) {
+		verifier := &fakeSignatureVerifier{
+			errs: map[Digest]error{
+				"sha256:aaa": fmt.Errorf("registry unavailable"),
+			},
+		}
+		check := &SignatureVerificationCheck{
+			SignerAccount: "signer-key",
+			PullEdges:     edges,
+			Verifier:      verifier,
+		}
+		if err := check.Run(); err == nil {
+			t.Fatal("expected an error, got nil")
+		} else if _, ok := err.(SignatureVerificationError); ok {
+			t.Fatalf("expected a plain error, got a SignatureVerificationError: %v", err)
+		}
+	})
+}
+
+func TestDanglingTagCheckCompare(t *testing.T) {
+	edge := func(digest Digest, tag Tag) PromotionEdge {
+		return PromotionEdge{
+			SrcRegistry: RegistryContext{Name: "gcr.io/src"},
+			SrcImageTag: ImageTag{ImageName: "foo", Tag: tag},
+			DstRegistry: RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: ImageTag{ImageName: "foo", Tag: tag},
+			Digest:      digest,
+		}
+	}
+
+	t.Run("does not flag a digest that keeps a tag in the PR", func(t *testing.T) {
+		check := &DanglingTagCheck{}
+		err := check.Compare(
+			map[PromotionEdge]interface{}{edge("sha256:aaa", "v1"): nil},
+			map[PromotionEdge]interface{}{edge("sha256:aaa", "v1"): nil},
+		)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("flags a digest dropped to no tags as pre-existing when master tagged it", func(t *testing.T) {
+		check := &DanglingTagCheck{}
+		err := check.Compare(
+			map[PromotionEdge]interface{}{edge("sha256:aaa", "v1"): nil},
+			map[PromotionEdge]interface{}{edge("sha256:aaa", ""): nil},
+		)
+		danglingErr, ok := err.(DanglingImageError)
+		if !ok {
+			t.Fatalf("expected a DanglingImageError, got %T (%v)", err, err)
+		}
+		if len(danglingErr.DanglingImages) != 1 || !danglingErr.DanglingImages[0].PreExisting {
+			t.Errorf("expected sha256:aaa to be flagged pre-existing, got %v",
+				danglingErr.DanglingImages)
+		}
+	})
+
+	t.Run("flags a digest dangling on master as newly-dangling, not pre-existing", func(t *testing.T) {
+		check := &DanglingTagCheck{}
+		err := check.Compare(
+			map[PromotionEdge]interface{}{edge("sha256:aaa", ""): nil},
+			map[PromotionEdge]interface{}{edge("sha256:aaa", ""): nil},
+		)
+		danglingErr, ok := err.(DanglingImageError)
+		if !ok {
+			t.Fatalf("expected a DanglingImageError, got %T (%v)", err, err)
+		}
+		if len(danglingErr.DanglingImages) != 1 || danglingErr.DanglingImages[0].PreExisting {
+			t.Errorf("expected sha256:aaa to not be flagged pre-existing, got %v",
+				danglingErr.DanglingImages)
+		}
+	})
+}
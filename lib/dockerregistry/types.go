@@ -0,0 +1,220 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import "gopkg.in/src-d/go-git.v4/plumbing"
+
+// SignatureVerifier abstracts fetching and cryptographically verifying a
+// source image's signature, so that SignatureVerificationCheck can be
+// unit-tested against a fake instead of a real registry and signer.
+type SignatureVerifier interface {
+	// VerifySignature returns nil if the image at digest carries a
+	// signature that verifies as having come from an authorized signer,
+	// errSignatureNotFound / errSignatureUnauthorized if it is unsigned or
+	// signed by someone else, or any other error if the verification could
+	// not be carried out (e.g. the registry or the signer key is unusable).
+	VerifySignature(
+		registry RegistryContext, image ImageName, digest Digest) error
+}
+
+// SignatureVerificationCheck is a Check that verifies every source image in
+// a set of promotion edges carries a valid cosign-style signature produced
+// by an authorized signer before it is allowed to be promoted.
+type SignatureVerificationCheck struct {
+	// SignerAccount identifies the configured signer, for inclusion in
+	// SignatureVerificationError; it is not used to verify anything
+	// itself -- that is Verifier's job.
+	SignerAccount string
+	PullEdges     map[PromotionEdge]interface{}
+	Verifier      SignatureVerifier
+}
+
+// SignatureVerificationError represents the images that failed signature
+// verification, split out by why they failed.
+type SignatureVerificationError struct {
+	SignerAccount      string
+	UnsignedImages     []string
+	UnauthorizedImages []string
+}
+
+// VulnFinding represents a single vulnerability finding for an image
+// digest, as reported by a VulnScanner.
+type VulnFinding struct {
+	CVE      string
+	Severity string
+}
+
+// VulnScanner abstracts a vulnerability scanning backend (e.g. Grype,
+// Trivy, or GCR's container analysis API) so that VulnerabilityCheck can
+// be unit-tested against a fake.
+type VulnScanner interface {
+	// Findings returns the vulnerability findings for the image at the
+	// given digest.
+	Findings(registry RegistryContext, image ImageName, digest Digest) (
+		[]VulnFinding, error)
+}
+
+// VulnerabilityCheck is a Check that fails a promotion if any image being
+// promoted has a known vulnerability at or above a configured severity
+// threshold.
+type VulnerabilityCheck struct {
+	SeverityThreshold string
+	PullEdges         map[PromotionEdge]interface{}
+	Scanner           VulnScanner
+}
+
+// VulnerabilityError represents the images that failed the vulnerability
+// check, grouped by the highest severity finding each one had.
+type VulnerabilityError struct {
+	SeverityThreshold string
+	ImagesBySeverity  map[string][]string
+}
+
+// Platform identifies a single platform (os/arch) entry of a
+// multi-architecture manifest list.
+type Platform struct {
+	OS           string
+	Architecture string
+}
+
+// ImageSize holds the size of an image digest. Single-platform images
+// report one entry in PerPlatform; manifest lists (OCI index or Docker
+// schema 2 list) report one entry per child platform manifest, since each
+// carries its own layers.
+type ImageSize struct {
+	PerPlatform map[Platform]int
+}
+
+// Total returns the sum of the image's size across all of its platforms.
+func (s ImageSize) Total() int {
+	total := 0
+	for _, size := range s.PerPlatform {
+		total += size
+	}
+	return total
+}
+
+// DigestImageSize maps an image digest to its (possibly per-platform)
+// size.
+type DigestImageSize map[Digest]ImageSize
+
+// ImageSizeCheck is a Check that verifies that all images to be promoted
+// are under a configured maximum size. MaxImageSizeTotal bounds the sum of
+// an image's size across all of its platforms; MaxImageSizePerPlatform
+// bounds any single platform's size for manifest lists. A value of 0
+// leaves that dimension unbounded.
+type ImageSizeCheck struct {
+	MaxImageSizeTotal       int
+	MaxImageSizePerPlatform int
+	DigestImageSize         DigestImageSize
+	PullEdges               map[PromotionEdge]interface{}
+}
+
+// ImageSizeError represents the images that failed the image size check.
+type ImageSizeError struct {
+	MaxImageSizeTotal       int
+	MaxImageSizePerPlatform int
+	OversizedImages         map[string]int
+	OversizedPlatformImages map[string]map[Platform]int
+	InvalidImages           map[string]int
+}
+
+// DanglingTagCheck is a Check that flags promotion edges whose destination
+// digest, after promotion, would no longer be referenced by any tag --
+// i.e. dangling. Whether a digest is dangling is decided from the pull
+// request's promotion edges alone; the master branch's edges are only
+// used to mark a dangling digest as pre-existing when master had a tag
+// on it. A digest that the pull request drops entirely is not flagged.
+// VCS resolves the master branch's promotion edges the same way
+// ImageRemovalCheck does, so both checks agree on what "master" means
+// without each reimplementing its own checkout logic.
+type DanglingTagCheck struct {
+	VCS       VCSProvider
+	PullEdges map[PromotionEdge]interface{}
+}
+
+// DanglingImage identifies a single dangling (untagged, unreferenced)
+// destination digest.
+type DanglingImage struct {
+	Registry RegistryName
+	Image    ImageName
+	Digest   Digest
+	// PreExisting is true if master already had at least one tag on this
+	// digest, meaning the pull request dropped its last tag rather than
+	// the digest having been dangling on master already.
+	PreExisting bool
+}
+
+// DanglingImageError represents the destination digests that would be
+// left dangling by a pull request.
+type DanglingImageError struct {
+	DanglingImages []DanglingImage
+}
+
+// VCSProvider abstracts how ImageRemovalCheck discovers the base and head
+// commits to compare and how it reads the promoter manifests as they
+// existed at a given commit. This lets the check run under different CI
+// systems -- or entirely outside of git -- without mutating the caller's
+// working tree.
+type VCSProvider interface {
+	// BaseRef returns the commit the pull request is being compared
+	// against (e.g. the target branch).
+	BaseRef() (plumbing.Hash, error)
+	// HeadRef returns the commit under test (e.g. the pull request's
+	// branch).
+	HeadRef() (plumbing.Hash, error)
+	// CheckoutManifestsAt returns the promoter manifests as they existed
+	// at hash, without disturbing the caller's working tree.
+	CheckoutManifestsAt(hash plumbing.Hash) ([]Manifest, error)
+}
+
+// ProwVCSProvider is a VCSProvider for the Prow jobs that run the promoter
+// container, which clone the repo for us and expose the base and pull
+// request SHAs via the PULL_BASE_SHA and PULL_PULL_SHA environment
+// variables.
+type ProwVCSProvider struct {
+	GitRepoPath string
+}
+
+// GitHubActionsVCSProvider is a VCSProvider for GitHub Actions, which
+// exposes the base and head SHAs via the GITHUB_BASE_SHA and GITHUB_SHA
+// environment variables.
+type GitHubActionsVCSProvider struct {
+	GitRepoPath string
+}
+
+// GitLabCIVCSProvider is a VCSProvider for GitLab CI, which exposes the
+// base and head SHAs via the CI_MERGE_REQUEST_DIFF_BASE_SHA and
+// CI_COMMIT_SHA environment variables.
+type GitLabCIVCSProvider struct {
+	GitRepoPath string
+}
+
+// DirVCSProvider is a VCSProvider for callers that have already
+// materialized both trees to compare on disk (e.g. a local dry run). It
+// skips git entirely.
+type DirVCSProvider struct {
+	BaseDir string
+	HeadDir string
+}
+
+// ImageRemovalCheck is a Check that fails a pull request which removes
+// images from the promoter manifests.
+type ImageRemovalCheck struct {
+	VCS       VCSProvider
+	PullEdges map[PromotionEdge]interface{}
+}